@@ -0,0 +1,31 @@
+package main
+
+import "fmt"
+
+// AttestCmd writes the attestation bundle for a key provisioned earlier,
+// without needing to regenerate it. The bundle goes to a PEM file under
+// Out; only the file's path is printed, not the bundle itself.
+type AttestCmd struct {
+	Card string `kong:"help='Specify a smart card device'"`
+	Slot string `kong:"arg,help='Slot to attest, e.g. 9a, 9c, or a retired slot in 82-95'"`
+	Out  string `kong:"default='.',help='Directory to write the PEM attestation bundle to'"`
+}
+
+// Run the attest command to write the attestation bundle for a previously
+// provisioned slot under cmd.Out and print the bundle's path.
+func (cmd *AttestCmd) Run() error {
+	slot, err := parseSlot(cmd.Slot)
+	if err != nil {
+		return fmt.Errorf("invalid slot: %w", err)
+	}
+	k, err := getSecurityKey(cmd.Card)
+	if err != nil {
+		return fmt.Errorf("couldn't get security key: %w", err)
+	}
+	path, err := writeAttestationBundle(k, slot, cmd.Out)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("📜 Wrote attestation bundle to %s\n", path)
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-piv/piv-go/piv"
+)
+
+// writeAttestationBundle fetches the YubiKey's F9 attestation
+// certificate and the slot's attestation statement, and writes both as a
+// single PEM bundle under dir, named after the slot. The bundle is the
+// verifiable chain (slot attestation -> F9 intermediate) an enrollment
+// server needs to confirm a key was generated on-device under the
+// declared touch/PIN policy, rather than imported.
+func writeAttestationBundle(k *piv.YubiKey, slot piv.Slot, dir string) (string, error) {
+	slotAttestation, err := k.Attest(slot)
+	if err != nil {
+		return "", fmt.Errorf("couldn't attest slot %v: %w", slot, err)
+	}
+	intermediate, err := k.AttestationCertificate()
+	if err != nil {
+		return "", fmt.Errorf("couldn't get attestation certificate: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("couldn't create attestation output dir: %w", err)
+	}
+	path := attestationBundlePath(dir, slot)
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("couldn't create %s: %w", path, err)
+	}
+	defer f.Close()
+	if err := pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: slotAttestation.Raw}); err != nil {
+		return "", fmt.Errorf("couldn't write slot attestation to %s: %w", path, err)
+	}
+	if err := pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: intermediate.Raw}); err != nil {
+		return "", fmt.Errorf("couldn't write attestation certificate to %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// attestationBundlePath is the path writeAttestationBundle writes a
+// slot's bundle to under dir. Callers that need to know the path without
+// generating the bundle (e.g. a --manifest report referencing a bundle
+// writeAttestationBundle already wrote) should use this instead of
+// reconstructing the filename themselves.
+func attestationBundlePath(dir string, slot piv.Slot) string {
+	return filepath.Join(dir, fmt.Sprintf("slot-%x.pem", slot.Key))
+}
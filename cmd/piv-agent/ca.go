@@ -0,0 +1,247 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-piv/piv-go/piv"
+)
+
+// CaInitCmd provisions a YubiKey as a CA HSM: it generates (or imports) a
+// root key and an on-card intermediate key, signs the intermediate with
+// the root, and writes real X.509 CA certificates to the card so it can
+// be dropped straight into a step-ca / smallstep style workflow.
+type CaInitCmd struct {
+	Card             string `kong:"help='Specify a smart card device'"`
+	PIN              uint64 `kong:"required,help='The PIN of the device'"`
+	RootOnly         bool   `kong:"help='Only provision the root certificate; skip the intermediate'"`
+	RootSlot         string `kong:"default='9a',help='Slot to hold the root CA key/certificate'"`
+	IntermediateSlot string `kong:"default='9c',help='Slot to hold the intermediate CA key/certificate'"`
+	RootFile         string `kong:"help='Import an existing off-card root certificate/key instead of generating one on-card'"`
+	KeyFile          string `kong:"help='Private key matching --root-file, required when --root-file is set'"`
+	Subject          string `kong:"default='piv-agent CA',help='Common name for the generated root/intermediate certificates'"`
+	ValidityYears    int    `kong:"default='10',help='Validity period, in years, of the generated certificates'"`
+	PathLen          int    `kong:"default='0',help='Max path length asserted by the intermediate certificate (0 means it may not sign further CAs); the root certificate asserts one more than this'"`
+}
+
+// Run the ca-init command to provision a YubiKey as a CA HSM.
+func (cmd *CaInitCmd) Run() error {
+	rootSlot, err := parseSlot(cmd.RootSlot)
+	if err != nil {
+		return fmt.Errorf("invalid --root-slot: %w", err)
+	}
+	intermediateSlot, err := parseSlot(cmd.IntermediateSlot)
+	if err != nil {
+		return fmt.Errorf("invalid --intermediate-slot: %w", err)
+	}
+	k, err := getSecurityKey(cmd.Card)
+	if err != nil {
+		return fmt.Errorf("couldn't get security key: %w", err)
+	}
+	mk, err := k.Metadata(strconv.FormatUint(cmd.PIN, 10))
+	if err != nil {
+		return fmt.Errorf("couldn't load management key, has the card been through `piv-agent setup`? %w", err)
+	}
+	if mk.ManagementKey == nil {
+		return fmt.Errorf("couldn't load management key, has the card been through `piv-agent setup`?")
+	}
+
+	var rootCert *x509.Certificate
+	var rootSigner crypto.Signer
+	if cmd.RootFile != "" {
+		rootCert, rootSigner, err = loadExternalRoot(cmd.RootFile, cmd.KeyFile)
+		if err != nil {
+			return fmt.Errorf("couldn't load external root: %w", err)
+		}
+	} else {
+		rootCert, rootSigner, err = cmd.generateRoot(k, *mk.ManagementKey, rootSlot)
+		if err != nil {
+			return fmt.Errorf("couldn't generate root CA: %w", err)
+		}
+		if err = writePEM("root_ca.crt", rootCert.Raw); err != nil {
+			return err
+		}
+	}
+
+	if cmd.RootOnly {
+		return nil
+	}
+	intermediateCert, err := cmd.generateIntermediate(k, *mk.ManagementKey, intermediateSlot, rootCert, rootSigner)
+	if err != nil {
+		return fmt.Errorf("couldn't generate intermediate CA: %w", err)
+	}
+	return writePEM("intermediate_ca.crt", intermediateCert.Raw)
+}
+
+// generateRoot generates a self-signed root CA key/certificate on-card in
+// the given slot.
+func (cmd *CaInitCmd) generateRoot(k *piv.YubiKey, mk [24]byte, slot piv.Slot) (*x509.Certificate, crypto.Signer, error) {
+	pub, err := k.GenerateKey(mk, slot, piv.Key{
+		Algorithm:   piv.AlgorithmEC384,
+		PINPolicy:   piv.PINPolicyAlways,
+		TouchPolicy: piv.TouchPolicyAlways,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't generate root key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't generate serial: %w", err)
+	}
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: cmd.Subject + " Root"},
+		SerialNumber:          serial,
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().AddDate(cmd.ValidityYears, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            cmd.PathLen + 1,
+		MaxPathLenZero:        cmd.PathLen+1 == 0,
+	}
+	signer, err := k.PrivateKey(slot, pub, piv.KeyAuth{PIN: strconv.FormatUint(cmd.PIN, 10)})
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't get root private key handle: %w", err)
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, pub, signer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't create root certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't parse root certificate: %w", err)
+	}
+	if err = k.SetCertificate(mk, slot, cert); err != nil {
+		return nil, nil, fmt.Errorf("couldn't store root certificate: %w", err)
+	}
+	return cert, signer.(crypto.Signer), nil
+}
+
+// generateIntermediate generates an on-card intermediate CA key and signs
+// it with rootSigner.
+func (cmd *CaInitCmd) generateIntermediate(k *piv.YubiKey, mk [24]byte, slot piv.Slot,
+	rootCert *x509.Certificate, rootSigner crypto.Signer) (*x509.Certificate, error) {
+	pub, err := k.GenerateKey(mk, slot, piv.Key{
+		Algorithm:   piv.AlgorithmEC384,
+		PINPolicy:   piv.PINPolicyAlways,
+		TouchPolicy: piv.TouchPolicyAlways,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't generate intermediate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't generate serial: %w", err)
+	}
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: cmd.Subject + " Intermediate"},
+		SerialNumber:          serial,
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().AddDate(cmd.ValidityYears, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		// crypto/x509 treats MaxPathLen==0 with MaxPathLenZero==false as
+		// "no pathLenConstraint asserted" (unconstrained), not "path len
+		// zero" - set MaxPathLenZero explicitly so --path-len=0 (the
+		// default) actually forbids the intermediate from signing further
+		// CAs, as documented on --path-len.
+		MaxPathLen:     cmd.PathLen,
+		MaxPathLenZero: cmd.PathLen == 0,
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, rootCert, pub, rootSigner)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create intermediate certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse intermediate certificate: %w", err)
+	}
+	if err = k.SetCertificate(mk, slot, cert); err != nil {
+		return nil, fmt.Errorf("couldn't store intermediate certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// loadExternalRoot reads an off-card root certificate and its matching
+// private key from disk so only the intermediate needs to be generated
+// on-card.
+func loadExternalRoot(certFile, keyFile string) (*x509.Certificate, crypto.Signer, error) {
+	if keyFile == "" {
+		return nil, nil, fmt.Errorf("--key-file is required when --root-file is set")
+	}
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't read root certificate: %w", err)
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, nil, fmt.Errorf("no PEM data found in %s", certFile)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't parse root certificate: %w", err)
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't read root key: %w", err)
+	}
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, nil, fmt.Errorf("no PEM data found in %s", keyFile)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't parse root key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("root key is not a signing key")
+	}
+	return cert, signer, nil
+}
+
+// parseSlot resolves a hex slot identifier such as "9a" to a piv.Slot.
+func parseSlot(s string) (piv.Slot, error) {
+	id, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return piv.Slot{}, fmt.Errorf("couldn't parse slot %q: %w", s, err)
+	}
+	switch uint32(id) {
+	case piv.SlotAuthentication.Key:
+		return piv.SlotAuthentication, nil
+	case piv.SlotSignature.Key:
+		return piv.SlotSignature, nil
+	case piv.SlotCardAuthentication.Key:
+		return piv.SlotCardAuthentication, nil
+	case piv.SlotKeyManagement.Key:
+		return piv.SlotKeyManagement, nil
+	}
+	retired, ok := piv.RetiredKeyManagementSlot(uint32(id))
+	if !ok {
+		return piv.Slot{}, fmt.Errorf("%q is not a valid PIV slot", s)
+	}
+	return retired, nil
+}
+
+// writePEM writes a DER-encoded certificate to path as PEM.
+func writePEM(path string, der []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("couldn't create %s: %w", path, err)
+	}
+	defer f.Close()
+	if err := pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+		return fmt.Errorf("couldn't write %s: %w", path, err)
+	}
+	fmt.Printf("📄 Wrote %s\n", path)
+	return nil
+}
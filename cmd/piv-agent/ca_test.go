@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-piv/piv-go/piv"
+)
+
+func TestParseSlot(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		wantKey uint32
+		wantErr bool
+	}{
+		{name: "authentication", in: "9a", wantKey: piv.SlotAuthentication.Key},
+		{name: "signature", in: "9c", wantKey: piv.SlotSignature.Key},
+		{name: "card authentication", in: "9e", wantKey: piv.SlotCardAuthentication.Key},
+		{name: "key management", in: "9d", wantKey: piv.SlotKeyManagement.Key},
+		{name: "retired slot", in: "82", wantKey: 0x82},
+		{name: "not hex", in: "zz", wantErr: true},
+		{name: "out of range", in: "ff", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSlot(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseSlot(%q) = %+v, want error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSlot(%q) returned error: %v", tt.in, err)
+			}
+			if got.Key != tt.wantKey {
+				t.Fatalf("parseSlot(%q).Key = %#x, want %#x", tt.in, got.Key, tt.wantKey)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/go-piv/piv-go/piv"
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest describes the full desired state of a card for non-interactive,
+// fleet-style provisioning: the PIN/PUK to set and the slot layout to
+// apply. It's parsed with the same (YAML, a JSON superset) decoder as
+// SlotsConfig so a manifest can embed its slot list directly.
+type Manifest struct {
+	PIN   string       `yaml:"pin"`
+	PUK   string       `yaml:"puk"`
+	Slots []SlotConfig `yaml:"slots"`
+}
+
+// loadManifest reads and parses a --manifest file.
+func loadManifest(path string) (*Manifest, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read manifest: %w", err)
+	}
+	var m Manifest
+	if err = yaml.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("couldn't parse manifest: %w", err)
+	}
+	if m.PIN == "" {
+		return nil, fmt.Errorf("manifest declares no pin")
+	}
+	if len(m.Slots) == 0 {
+		return nil, fmt.Errorf("manifest declares no slots")
+	}
+	return &m, nil
+}
+
+// SlotReport is one slot's entry in a --manifest JSON report.
+type SlotReport struct {
+	Slot              string `json:"slot"`
+	PublicKeySSH      string `json:"public_key_ssh,omitempty"`
+	AttestationBundle string `json:"attestation_bundle,omitempty"`
+	Changed           bool   `json:"changed"`
+}
+
+// SetupReport is the machine-readable result of a --manifest apply or
+// --dry-run, for a fleet-management system to ingest.
+type SetupReport struct {
+	Serial uint32       `json:"serial"`
+	DryRun bool         `json:"dry_run"`
+	Slots  []SlotReport `json:"slots"`
+}
+
+// runManifest applies (or, with --dry-run, previews) a --manifest against
+// k without any interactive prompting, then writes a JSON report. Slots
+// whose diffSlot reports no change are left untouched, which is what
+// makes re-running the same manifest against an already-provisioned card
+// idempotent.
+func (cmd *SetupCmd) runManifest(ctx context.Context, k *piv.YubiKey) error {
+	m, err := loadManifest(cmd.Manifest)
+	if err != nil {
+		return err
+	}
+	slots, err := (&SlotsConfig{Slots: m.Slots}).resolve(k)
+	if err != nil {
+		return err
+	}
+	serial, err := k.Serial()
+	if err != nil {
+		return fmt.Errorf("couldn't read card serial: %w", err)
+	}
+	report := SetupReport{Serial: serial, DryRun: cmd.DryRun}
+
+	if cmd.DryRun {
+		for _, rs := range slots {
+			changed, err := cmd.diffSlot(k, rs)
+			if err != nil {
+				return fmt.Errorf("couldn't diff slot %v: %w", rs.slot, err)
+			}
+			report.Slots = append(report.Slots, SlotReport{
+				Slot:    fmt.Sprintf("%x", rs.slot.Key),
+				Changed: changed,
+			})
+		}
+		return cmd.writeReport(report)
+	}
+
+	mk, err := cmd.manifestManagementKey(k, m)
+	if err != nil {
+		return err
+	}
+
+	prompter, err := newPrompter(cmd.Prompt)
+	if err != nil {
+		return err
+	}
+	for _, rs := range slots {
+		changed, err := cmd.diffSlot(k, rs)
+		if err != nil {
+			return fmt.Errorf("couldn't diff slot %v: %w", rs.slot, err)
+		}
+		sr := SlotReport{Slot: fmt.Sprintf("%x", rs.slot.Key), Changed: changed}
+		if changed {
+			pubKey, err := cmd.configureSlot(ctx, k, mk, rs, prompter)
+			if err != nil {
+				return fmt.Errorf("couldn't configure slot %v: %w", rs.slot, err)
+			}
+			sr.PublicKeySSH = pubKey
+			if cmd.AttestationOut != "" {
+				sr.AttestationBundle = attestationBundlePath(cmd.AttestationOut, rs.slot)
+			}
+		}
+		report.Slots = append(report.Slots, sr)
+	}
+	return cmd.writeReport(report)
+}
+
+// manifestManagementKey authenticates against k's management key,
+// provisioning it (along with the PIN/PUK) from the factory defaults on a
+// fresh card, or reading back what a previous --manifest apply stored on
+// one that's already provisioned.
+//
+// Which case applies is decided by trying the factory management key
+// first, never by guessing a PIN: a wrong PIN consumes one of the card's
+// few PIN retries, but a wrong management key doesn't touch that counter,
+// so probing with SetManagementKey is the side-effect-free way to tell a
+// fresh card from an already-provisioned one before touching the PIN at
+// all.
+func (cmd *SetupCmd) manifestManagementKey(k *piv.YubiKey, m *Manifest) ([24]byte, error) {
+	var mk [24]byte
+	if _, err := rand.Read(mk[:]); err != nil {
+		return mk, fmt.Errorf("couldn't get random bytes: %w", err)
+	}
+	if err := k.SetManagementKey(piv.DefaultManagementKey, mk); err != nil {
+		// Not the factory management key: a previous apply of this same
+		// manifest must have already set PIN/PUK/management key to
+		// m.PIN, so re-authenticate with that instead of the defaults.
+		meta, metaErr := k.Metadata(m.PIN)
+		if metaErr != nil || meta.ManagementKey == nil {
+			return mk, fmt.Errorf("card isn't using the factory management key and has no stored management key under this manifest's PIN: %w", err)
+		}
+		return *meta.ManagementKey, nil
+	}
+	if err := k.SetMetadata(mk, &piv.Metadata{ManagementKey: &mk}); err != nil {
+		return mk, fmt.Errorf("couldn't store management key: %w", err)
+	}
+	if err := k.SetPIN(piv.DefaultPIN, m.PIN); err != nil {
+		return mk, fmt.Errorf("couldn't set PIN: %w", err)
+	}
+	puk := m.PUK
+	if puk == "" {
+		puk = m.PIN
+	}
+	if err := k.SetPUK(piv.DefaultPUK, puk); err != nil {
+		return mk, fmt.Errorf("couldn't set PUK: %w", err)
+	}
+	return mk, nil
+}
+
+// diffSlot reports whether rs's desired state differs from what rs.slot
+// currently holds: no certificate yet, or one wrapping a key of a
+// different algorithm than the manifest now declares. It doesn't compare
+// PIN/touch policy, since those aren't recoverable from the stored
+// certificate alone (only from a fresh attestation, which needs a touch
+// and isn't worth the round trip just to preview a diff).
+func (cmd *SetupCmd) diffSlot(k *piv.YubiKey, rs resolvedSlot) (bool, error) {
+	cert, err := k.Certificate(rs.slot)
+	if errors.Is(err, piv.ErrNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("couldn't read certificate: %w", err)
+	}
+	return !algorithmMatchesKey(rs.algorithm.algorithm, cert.PublicKey), nil
+}
+
+// writeReport marshals a SetupReport to cmd.Report, or stdout if unset.
+func (cmd *SetupCmd) writeReport(report SetupReport) error {
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't marshal report: %w", err)
+	}
+	if cmd.Report == "" {
+		fmt.Println(string(out))
+		return nil
+	}
+	if err := os.WriteFile(cmd.Report, out, 0o600); err != nil {
+		return fmt.Errorf("couldn't write report to %s: %w", cmd.Report, err)
+	}
+	fmt.Printf("📋 Wrote report to %s\n", cmd.Report)
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadManifest(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "manifest.yaml")
+	writeFile(t, path, `
+pin: "12345678"
+puk: "87654321"
+slots:
+  - slot: "9a"
+    algorithm: ec256
+`)
+	m, err := loadManifest(path)
+	if err != nil {
+		t.Fatalf("loadManifest returned error: %v", err)
+	}
+	if m.PIN != "12345678" || m.PUK != "87654321" {
+		t.Errorf("unexpected pin/puk: %+v", m)
+	}
+	if len(m.Slots) != 1 || m.Slots[0].Slot != "9a" {
+		t.Errorf("unexpected slots: %+v", m.Slots)
+	}
+}
+
+func TestLoadManifestRequiresPIN(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "manifest.yaml")
+	writeFile(t, path, `
+slots:
+  - slot: "9a"
+`)
+	if _, err := loadManifest(path); err == nil {
+		t.Fatal("expected an error for a manifest with no pin")
+	}
+}
+
+func TestLoadManifestRequiresSlots(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "manifest.yaml")
+	writeFile(t, path, `pin: "12345678"`+"\n")
+	if _, err := loadManifest(path); err == nil {
+		t.Fatal("expected an error for a manifest with no slots")
+	}
+}
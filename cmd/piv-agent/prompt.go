@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/go-piv/piv-go/piv"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// Prompter asks the user for a PIN/PUK or to touch the security key.
+// SetupCmd's PIN/PUK prompt, which used to call terminal.ReadPassword
+// directly, goes through a Prompter instead, so headless or GUI-only
+// sessions (no controlling TTY) still have a working prompt.
+//
+// Only SetupCmd (the one-time provisioning command) goes through
+// Prompter so far; the long-running ssh-agent/gpg-agent signing path
+// that blocks on a PIN/touch prompt during everyday use isn't part of
+// this tree and still needs the same treatment.
+type Prompter interface {
+	// PromptPIN asks for a new or existing PIN/PUK and returns it as a
+	// string of digits.
+	PromptPIN(ctx context.Context) (string, error)
+	// PromptTouch tells the user a touch is required for slot under
+	// policy. It returns once the request has been shown; it does not
+	// wait for the touch itself, since the YubiKey blocks the triggering
+	// call until the card is touched or the operation times out.
+	PromptTouch(ctx context.Context, slot piv.Slot, policy piv.TouchPolicy) error
+}
+
+// newPrompter resolves the --prompt flag to a concrete Prompter.
+func newPrompter(name string) (Prompter, error) {
+	switch name {
+	case "", "tty":
+		return &TTYPrompter{}, nil
+	case "pinentry":
+		return &PinentryPrompter{}, nil
+	case "notify":
+		return &NotifyPrompter{fallback: &TTYPrompter{}}, nil
+	}
+	return nil, fmt.Errorf("unknown --prompt %q, want tty, pinentry or notify", name)
+}
+
+// TTYPrompter reads the PIN from the controlling terminal and prints a
+// touch reminder to stdout. It's the original, default behaviour.
+type TTYPrompter struct{}
+
+// PromptPIN implements Prompter.
+func (p *TTYPrompter) PromptPIN(ctx context.Context) (string, error) {
+	fmt.Print("Enter a new PIN/PUK (6-8 digits): ")
+	rawPIN, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("couldn't read PIN/PUK: %w", err)
+	}
+	pin := string(rawPIN)
+	if _, err := strconv.ParseUint(pin, 10, 64); err != nil {
+		return "", fmt.Errorf("invalid characters: %w", err)
+	}
+	fmt.Print("Repeat PIN/PUK: ")
+	repeat, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("couldn't read PIN/PUK: %w", err)
+	}
+	if !bytes.Equal(repeat, rawPIN) {
+		return "", fmt.Errorf("PIN/PUK entries not equal")
+	}
+	return pin, nil
+}
+
+// PromptTouch implements Prompter.
+func (p *TTYPrompter) PromptTouch(ctx context.Context, slot piv.Slot, policy piv.TouchPolicy) error {
+	if policy == piv.TouchPolicyNever {
+		return nil
+	}
+	fmt.Printf("👆 Touch the security key to continue (slot %v)\n", slot)
+	return nil
+}
+
+// PinentryPrompter asks via the GnuPG pinentry protocol, for desktop
+// environments that already run a pinentry program (gnome-keyring,
+// pinentry-gtk, pinentry-mac, ...).
+type PinentryPrompter struct {
+	// Path to the pinentry binary. Defaults to "pinentry" on $PATH.
+	Path string
+}
+
+func (p *PinentryPrompter) path() string {
+	if p.Path != "" {
+		return p.Path
+	}
+	return "pinentry"
+}
+
+// assuan speaks just enough of the Assuan protocol pinentry uses: send a
+// command, read lines until "OK" or "ERR", and return the last "D" (data)
+// line it saw.
+func assuan(ctx context.Context, path string, commands ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, path)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return "", fmt.Errorf("couldn't open pinentry stdin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", fmt.Errorf("couldn't open pinentry stdout: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("couldn't start pinentry: %w", err)
+	}
+	scanner := bufio.NewScanner(stdout)
+	data := ""
+	readUntilOK := func() error {
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "OK" || strings.HasPrefix(line, "OK "):
+				return nil
+			case strings.HasPrefix(line, "ERR "):
+				return fmt.Errorf("pinentry: %s", strings.TrimPrefix(line, "ERR "))
+			case strings.HasPrefix(line, "D "):
+				data = strings.TrimPrefix(line, "D ")
+			}
+		}
+		return fmt.Errorf("pinentry closed without a final response")
+	}
+	if err := readUntilOK(); err != nil {
+		return "", err
+	}
+	for _, c := range commands {
+		if _, err := fmt.Fprintf(stdin, "%s\n", c); err != nil {
+			return "", fmt.Errorf("couldn't write to pinentry: %w", err)
+		}
+		if err := readUntilOK(); err != nil {
+			return "", err
+		}
+	}
+	stdin.Close()
+	_ = cmd.Wait()
+	return data, nil
+}
+
+// PromptPIN implements Prompter. It asks twice and requires the two
+// entries to match, the same way TTYPrompter.PromptPIN does, so a typo
+// can't silently become the card's new PIN/PUK.
+func (p *PinentryPrompter) PromptPIN(ctx context.Context) (string, error) {
+	pin, err := p.promptPINOnce(ctx, "Enter a new PIN/PUK (6-8 digits) for your security key")
+	if err != nil {
+		return "", err
+	}
+	repeat, err := p.promptPINOnce(ctx, "Repeat the PIN/PUK to confirm")
+	if err != nil {
+		return "", err
+	}
+	if repeat != pin {
+		return "", fmt.Errorf("PIN/PUK entries not equal")
+	}
+	return pin, nil
+}
+
+// promptPINOnce asks pinentry for a PIN/PUK once, with desc as its
+// description text.
+func (p *PinentryPrompter) promptPINOnce(ctx context.Context, desc string) (string, error) {
+	pin, err := assuan(ctx, p.path(),
+		"SETDESC "+desc,
+		"SETPROMPT PIN/PUK:",
+		"GETPIN")
+	if err != nil {
+		return "", fmt.Errorf("couldn't read PIN/PUK from pinentry: %w", err)
+	}
+	if _, err := strconv.ParseUint(pin, 10, 64); err != nil {
+		return "", fmt.Errorf("invalid characters: %w", err)
+	}
+	return pin, nil
+}
+
+// PromptTouch implements Prompter.
+func (p *PinentryPrompter) PromptTouch(ctx context.Context, slot piv.Slot, policy piv.TouchPolicy) error {
+	if policy == piv.TouchPolicyNever {
+		return nil
+	}
+	_, err := assuan(ctx, p.path(),
+		fmt.Sprintf("SETDESC Touch your security key to continue (slot %v)", slot),
+		"MESSAGE")
+	if err != nil {
+		return fmt.Errorf("couldn't show pinentry touch message: %w", err)
+	}
+	return nil
+}
+
+// NotifyPrompter shows a desktop notification for touch requests, via
+// notify-send on Linux or osascript on macOS. Desktop notifications can't
+// collect a secret, so PIN entry falls back to another Prompter.
+type NotifyPrompter struct {
+	fallback Prompter
+}
+
+// PromptPIN implements Prompter.
+func (p *NotifyPrompter) PromptPIN(ctx context.Context) (string, error) {
+	return p.fallback.PromptPIN(ctx)
+}
+
+// PromptTouch implements Prompter.
+func (p *NotifyPrompter) PromptTouch(ctx context.Context, slot piv.Slot, policy piv.TouchPolicy) error {
+	if policy == piv.TouchPolicyNever {
+		return nil
+	}
+	message := fmt.Sprintf("Touch your security key to continue (slot %v)", slot)
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.CommandContext(ctx, "osascript", "-e",
+			fmt.Sprintf("display notification %q with title \"piv-agent\"", message))
+	default:
+		cmd = exec.CommandContext(ctx, "notify-send", "piv-agent", message)
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("couldn't show touch notification: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestMain lets this test binary re-exec itself as a fake pinentry, driven
+// by the ASSUAN_TEST_SCRIPT env var, so TestAssuan can exercise assuan() against
+// a real subprocess without a real pinentry installed.
+func TestMain(m *testing.M) {
+	if script := os.Getenv("ASSUAN_TEST_SCRIPT"); script != "" {
+		runFakePinentry(script)
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// runFakePinentry speaks just enough Assuan to drive assuan(): it greets
+// with "OK", then for each received command looks up a scripted response
+// in script (one "command=response" pair per line, response lines
+// separated by ";").
+func runFakePinentry(script string) {
+	responses := map[string]string{}
+	for _, line := range strings.Split(script, "\n") {
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		responses[parts[0]] = parts[1]
+	}
+	fmt.Println("OK Pleased to meet you")
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		cmd := strings.SplitN(scanner.Text(), " ", 2)[0]
+		resp, ok := responses[cmd]
+		if !ok {
+			fmt.Println("ERR unknown command")
+			continue
+		}
+		for _, respLine := range strings.Split(resp, ";") {
+			fmt.Println(respLine)
+		}
+	}
+}
+
+func assuanTestBinary(t *testing.T, script string) string {
+	t.Helper()
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatalf("couldn't find test binary: %v", err)
+	}
+	t.Setenv("ASSUAN_TEST_SCRIPT", script)
+	return self
+}
+
+func TestAssuan(t *testing.T) {
+	path := assuanTestBinary(t, "GETPIN=D 123456;OK")
+	got, err := assuan(context.Background(), path, "GETPIN")
+	if err != nil {
+		t.Fatalf("assuan returned error: %v", err)
+	}
+	if got != "123456" {
+		t.Errorf("assuan data = %q, want %q", got, "123456")
+	}
+}
+
+func TestAssuanError(t *testing.T) {
+	path := assuanTestBinary(t, "GETPIN=ERR 83886179 Operation cancelled")
+	_, err := assuan(context.Background(), path, "GETPIN")
+	if err == nil {
+		t.Fatal("expected an error from a pinentry ERR response")
+	}
+	if !strings.Contains(err.Error(), "Operation cancelled") {
+		t.Errorf("error = %v, want it to mention the pinentry message", err)
+	}
+}
+
+func TestAssuanMultipleCommands(t *testing.T) {
+	path := assuanTestBinary(t, "SETDESC=OK\nMESSAGE=OK")
+	got, err := assuan(context.Background(), path, "SETDESC hello", "MESSAGE")
+	if err != nil {
+		t.Fatalf("assuan returned error: %v", err)
+	}
+	if got != "" {
+		t.Errorf("assuan data = %q, want empty (no D line was sent)", got)
+	}
+}
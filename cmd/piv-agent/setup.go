@@ -1,42 +1,66 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"errors"
 	"fmt"
 	"math/big"
-	"os"
 	"strconv"
 	"time"
 
 	"github.com/go-piv/piv-go/piv"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/ssh"
-	"golang.org/x/crypto/ssh/terminal"
 )
 
-// SetupCmd represents the setup command.
+// SetupCmd represents the setup command. It only covers provisioning: the
+// long-running ssh-agent/gpg-agent code that signs with a previously
+// generated key isn't part of this tree, so it doesn't yet know how to
+// advertise the non-EC256 key types this command can now produce.
 type SetupCmd struct {
-	Card             string `kong:"help='Specify a smart card device'"`
-	ResetSecurityKey bool   `kong:"help='Overwrite any existing keys'"`
-	PIN              uint64 `kong:"help='Set the PIN/PUK of the device (6-8 digits). Will be prompted interactively if not provided.'"`
-	AllTouchPolicies bool   `kong:"default='true',help='Create two additional keys with touch policies always and never (default true)'"`
+	Card             string   `kong:"help='Specify a smart card device'"`
+	ResetSecurityKey bool     `kong:"help='Overwrite any existing keys'"`
+	PIN              uint64   `kong:"help='Set the PIN/PUK of the device (6-8 digits). Will be prompted interactively if not provided.'"`
+	AllTouchPolicies bool     `kong:"default='true',help='Create two additional keys with touch policies always and never (default true)'"`
+	Algorithm        []string `kong:"help='Key algorithm(s) to generate, one per slot in the order authentication, signature, card-authentication (default ec256 for every slot). One of: ec256, ec384, rsa2048, ed25519. rsa3072, rsa4096 and x25519 are accepted but rejected at runtime: piv-go does not yet expose piv.Algorithm constants for them.'"`
+	SlotsConfig      string   `kong:"help='Path to a YAML file declaring an arbitrary slot layout (including the retired key-management slots), overriding --algorithm and --all-touch-policies'"`
+	AttestationOut   string   `kong:"help='Directory to write a PEM attestation bundle (slot attestation + F9 intermediate) for each generated key'"`
+	Prompt           string   `kong:"default='tty',help='How to prompt for the PIN/PUK and touch: tty, pinentry or notify'"`
+	Manifest         string   `kong:"help='Path to a manifest file describing the full desired card state, for non-interactive fleet provisioning'"`
+	DryRun           bool     `kong:"help='With --manifest, report what would change without touching the card'"`
+	Report           string   `kong:"help='With --manifest, path to write the JSON result report (default: stdout)'"`
 }
 
 type slotSpec struct {
 	slot        piv.Slot
 	touchPolicy piv.TouchPolicy
+	algorithm   piv.Algorithm
 }
 
 var allKeySpec = []slotSpec{
-	{piv.SlotAuthentication, piv.TouchPolicyCached},
-	{piv.SlotSignature, piv.TouchPolicyAlways},
-	{piv.SlotCardAuthentication, piv.TouchPolicyNever},
+	{piv.SlotAuthentication, piv.TouchPolicyCached, piv.AlgorithmEC256},
+	{piv.SlotSignature, piv.TouchPolicyAlways, piv.AlgorithmEC256},
+	{piv.SlotCardAuthentication, piv.TouchPolicyNever, piv.AlgorithmEC256},
+}
+
+// resolvedSlot is the fully-resolved description of a single slot to
+// configure: either one entry of the built-in layout combined with a
+// keyAlgorithm, or one entry of a --slots-config file.
+type resolvedSlot struct {
+	slot          piv.Slot
+	touchPolicy   piv.TouchPolicy
+	pinPolicy     piv.PINPolicy
+	algorithm     keyAlgorithm
+	subject       string
+	validityYears int
 }
 
 var touchStringMap = map[piv.TouchPolicy]string{
@@ -45,35 +69,101 @@ var touchStringMap = map[piv.TouchPolicy]string{
 	piv.TouchPolicyCached: "cached",
 }
 
-type sshPubKeySpec struct {
-	pubKey      ssh.PublicKey
-	slot        piv.Slot
-	touchPolicy piv.TouchPolicy
-	card        string
-	serial      uint32
+// keyAlgorithm describes a user-selectable PIV key algorithm: the piv-go
+// constant to request when generating the key, the key usage bits the
+// wrapping certificate should carry, and the minimum YubiKey firmware
+// version that supports it. pending is set for algorithms piv-go doesn't
+// expose a piv.Algorithm constant for yet.
+type keyAlgorithm struct {
+	algorithm  piv.Algorithm
+	keyUsage   x509.KeyUsage
+	minVersion piv.Version
+	pending    bool
 }
 
-func interactivePIN() (uint64, error) {
-	fmt.Print("Enter a new PIN/PUK (6-8 digits): ")
-	rawPIN, err := terminal.ReadPassword(int(os.Stdin.Fd()))
-	fmt.Println()
-	if err != nil {
-		return 0, fmt.Errorf("couldn't read PIN/PUK: %w", err)
+var keyAlgorithms = map[string]keyAlgorithm{
+	"ec256": {algorithm: piv.AlgorithmEC256,
+		keyUsage: x509.KeyUsageKeyAgreement | x509.KeyUsageDigitalSignature},
+	"ec384": {algorithm: piv.AlgorithmEC384,
+		keyUsage: x509.KeyUsageKeyAgreement | x509.KeyUsageDigitalSignature},
+	"rsa2048": {algorithm: piv.AlgorithmRSA2048,
+		keyUsage: x509.KeyUsageDigitalSignature},
+	"ed25519": {algorithm: piv.AlgorithmEd25519,
+		keyUsage: x509.KeyUsageDigitalSignature, minVersion: piv.Version{Major: 5, Minor: 7}},
+	// rsa3072, rsa4096 and x25519 are recognised so --algorithm gives a
+	// precise error, but piv-go doesn't define piv.Algorithm constants
+	// for them yet (tracked upstream); wire these up once it does.
+	"rsa3072": {pending: true},
+	"rsa4096": {pending: true},
+	"x25519":  {pending: true},
+}
+
+// versionAtLeast reports whether v satisfies the (Major, Minor) floor
+// required by min. YubiKey firmware versions don't carry a meaningful
+// patch-level feature gate, so only major/minor are compared.
+func versionAtLeast(v, min piv.Version) bool {
+	if v.Major != min.Major {
+		return v.Major > min.Major
 	}
-	pin, err := strconv.ParseUint(string(rawPIN), 10, 64)
-	if err != nil {
-		return 0, fmt.Errorf("invalid characters: %w", err)
+	return v.Minor >= min.Minor
+}
+
+// algorithmMatchesKey reports whether pub, as read back from a stored
+// certificate, is consistent with having been generated as alg.
+func algorithmMatchesKey(alg piv.Algorithm, pub crypto.PublicKey) bool {
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch alg {
+		case piv.AlgorithmEC256:
+			return key.Curve == elliptic.P256()
+		case piv.AlgorithmEC384:
+			return key.Curve == elliptic.P384()
+		}
+		return false
+	case *rsa.PublicKey:
+		return alg == piv.AlgorithmRSA2048 && key.N.BitLen() == 2048
+	case ed25519.PublicKey:
+		return alg == piv.AlgorithmEd25519
+	default:
+		return false
 	}
-	fmt.Print("Repeat PIN/PUK: ")
-	repeat, err := terminal.ReadPassword(int(os.Stdin.Fd()))
-	fmt.Println()
-	if err != nil {
-		return 0, fmt.Errorf("couldn't read PIN/PUK: %w", err)
+}
+
+// parseAlgorithms validates cmd.Algorithm against the security key's
+// firmware capabilities and returns one keyAlgorithm per requested slot,
+// defaulting unspecified slots to EC256.
+func (cmd *SetupCmd) parseAlgorithms(k *piv.YubiKey, slots int) ([]keyAlgorithm, error) {
+	version := k.Version()
+	result := make([]keyAlgorithm, slots)
+	for i := range result {
+		result[i] = keyAlgorithms["ec256"]
 	}
-	if !bytes.Equal(repeat, rawPIN) {
-		return 0, fmt.Errorf("PIN/PUK entries not equal")
+	for i, name := range cmd.Algorithm {
+		if i >= slots {
+			return nil, fmt.Errorf("more --algorithm values given than slots being configured")
+		}
+		alg, ok := keyAlgorithms[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown algorithm %q", name)
+		}
+		if alg.pending {
+			return nil, fmt.Errorf("algorithm %q is not yet supported by this build's piv-go dependency", name)
+		}
+		if !versionAtLeast(version, alg.minVersion) {
+			return nil, fmt.Errorf("algorithm %q requires YubiKey firmware %d.%d or later, found %d.%d",
+				name, alg.minVersion.Major, alg.minVersion.Minor, version.Major, version.Minor)
+		}
+		result[i] = alg
 	}
-	return pin, nil
+	return result, nil
+}
+
+type sshPubKeySpec struct {
+	pubKey      ssh.PublicKey
+	slot        piv.Slot
+	touchPolicy piv.TouchPolicy
+	card        string
+	serial      uint32
 }
 
 // Run the setup command to configure a security key.
@@ -83,24 +173,36 @@ func (cmd *SetupCmd) Run() error {
 		return fmt.Errorf("couldn't init logger: %w", err)
 	}
 	defer log.Sync()
+	ctx := context.Background()
+	k, err := getSecurityKey(cmd.Card)
+	if err != nil {
+		return fmt.Errorf("couldn't get security key: %w", err)
+	}
+	if cmd.Manifest != "" {
+		return cmd.runManifest(ctx, k)
+	}
+	prompter, err := newPrompter(cmd.Prompt)
+	if err != nil {
+		return err
+	}
 	// if PIN has not been specified, ask interactively
 	if cmd.PIN == 0 {
-		cmd.PIN, err = interactivePIN()
+		pin, err := prompter.PromptPIN(ctx)
 		if err != nil {
 			return err
 		}
+		cmd.PIN, err = strconv.ParseUint(pin, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid characters: %w", err)
+		}
 	}
 	if cmd.PIN < 100000 || cmd.PIN > 99999999 {
 		return fmt.Errorf("invalid PIN, must be 6-8 digits")
 	}
-	k, err := getSecurityKey(cmd.Card)
-	if err != nil {
-		return fmt.Errorf("couldn't get security key: %w", err)
-	}
-	return cmd.setup(k)
+	return cmd.setup(ctx, k, prompter)
 }
 
-func (cmd *SetupCmd) setup(k *piv.YubiKey) error {
+func (cmd *SetupCmd) setup(ctx context.Context, k *piv.YubiKey, prompter Prompter) error {
 	_, err := k.Certificate(piv.SlotAuthentication)
 	if err == nil {
 		if !cmd.ResetSecurityKey {
@@ -129,33 +231,78 @@ func (cmd *SetupCmd) setup(k *piv.YubiKey) error {
 	if err = k.SetPUK(piv.DefaultPUK, pin); err != nil {
 		return fmt.Errorf("couldn't set PUK: %w", err)
 	}
+	slots, err := cmd.resolveSlots(k)
+	if err != nil {
+		return err
+	}
+	for _, rs := range slots {
+		if _, err = cmd.configureSlot(ctx, k, mk, rs, prompter); err != nil {
+			return fmt.Errorf("couldn't configure slot %v: %w", rs.slot, err)
+		}
+	}
+	return nil
+}
+
+// resolveSlots builds the list of slots to configure, either from a
+// --slots-config file or from the built-in layout combined with
+// --algorithm/--all-touch-policies.
+func (cmd *SetupCmd) resolveSlots(k *piv.YubiKey) ([]resolvedSlot, error) {
+	if cmd.SlotsConfig != "" {
+		config, err := loadSlotsConfig(cmd.SlotsConfig)
+		if err != nil {
+			return nil, err
+		}
+		return config.resolve(k)
+	}
 	keySpec := []slotSpec{
-		{piv.SlotAuthentication, piv.TouchPolicyCached},
+		{piv.SlotAuthentication, piv.TouchPolicyCached, piv.AlgorithmEC256},
 	}
 	if cmd.AllTouchPolicies {
 		keySpec = allKeySpec
 	}
-	for _, ss := range keySpec {
-		if err = cmd.configureSlot(k, mk, ss.slot, ss.touchPolicy); err != nil {
-			return fmt.Errorf("couldn't configure slot %v: %w", ss.slot, err)
+	algorithms, err := cmd.parseAlgorithms(k, len(keySpec))
+	if err != nil {
+		return nil, err
+	}
+	slots := make([]resolvedSlot, len(keySpec))
+	for i, ss := range keySpec {
+		slots[i] = resolvedSlot{
+			slot:          ss.slot,
+			touchPolicy:   ss.touchPolicy,
+			pinPolicy:     piv.PINPolicyOnce,
+			algorithm:     algorithms[i],
+			subject:       "SSH key",
+			validityYears: 64,
 		}
 	}
-	return nil
+	return slots, nil
 }
 
-func (cmd *SetupCmd) configureSlot(k *piv.YubiKey, mk [24]byte,
-	slot piv.Slot, touchPolicy piv.TouchPolicy) error {
-	pub, err := k.GenerateKey(mk, slot, piv.Key{
-		Algorithm:   piv.AlgorithmEC256,
-		PINPolicy:   piv.PINPolicyOnce,
-		TouchPolicy: touchPolicy,
+// configureSlot generates a key in rs.slot and wraps it in a certificate,
+// returning the generated key's SSH authorized_keys-format public key.
+func (cmd *SetupCmd) configureSlot(ctx context.Context, k *piv.YubiKey, mk [24]byte,
+	rs resolvedSlot, prompter Prompter) (string, error) {
+	if err := prompter.PromptTouch(ctx, rs.slot, rs.touchPolicy); err != nil {
+		return "", fmt.Errorf("couldn't prompt for touch: %w", err)
+	}
+	pub, err := k.GenerateKey(mk, rs.slot, piv.Key{
+		Algorithm:   rs.algorithm.algorithm,
+		PINPolicy:   rs.pinPolicy,
+		TouchPolicy: rs.touchPolicy,
 	})
 	if err != nil {
-		return fmt.Errorf("couldn't generate key: %w", err)
+		return "", fmt.Errorf("couldn't generate key: %w", err)
+	}
+	if cmd.AttestationOut != "" {
+		path, err := writeAttestationBundle(k, rs.slot, cmd.AttestationOut)
+		if err != nil {
+			return "", fmt.Errorf("couldn't write attestation bundle: %w", err)
+		}
+		fmt.Printf("📜 Wrote attestation bundle to %s\n", path)
 	}
 	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
-		return fmt.Errorf("couldn't generate parent key: %w", err)
+		return "", fmt.Errorf("couldn't generate parent key: %w", err)
 	}
 	parent := &x509.Certificate{
 		Subject: pkix.Name{
@@ -166,34 +313,35 @@ func (cmd *SetupCmd) configureSlot(k *piv.YubiKey, mk [24]byte,
 	}
 	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
 	if err != nil {
-		return fmt.Errorf("couldn't generate serial: %w", err)
+		return "", fmt.Errorf("couldn't generate serial: %w", err)
 	}
 	template := &x509.Certificate{
 		Subject: pkix.Name{
-			CommonName: "SSH key",
+			CommonName: rs.subject,
 		},
-		NotAfter:     time.Now().AddDate(64, 0, 0),
+		NotAfter:     time.Now().AddDate(rs.validityYears, 0, 0),
 		NotBefore:    time.Now(),
 		SerialNumber: serial,
-		KeyUsage:     x509.KeyUsageKeyAgreement | x509.KeyUsageDigitalSignature,
+		KeyUsage:     rs.algorithm.keyUsage,
 	}
 	certBytes, err := x509.CreateCertificate(rand.Reader, template, parent, pub, priv)
 	if err != nil {
-		return fmt.Errorf("couldn't create certificate: %w", err)
+		return "", fmt.Errorf("couldn't create certificate: %w", err)
 	}
 	cert, err := x509.ParseCertificate(certBytes)
 	if err != nil {
-		return fmt.Errorf("couldn't parse certificate: %w", err)
+		return "", fmt.Errorf("couldn't parse certificate: %w", err)
 	}
-	if err = k.SetCertificate(mk, slot, cert); err != nil {
-		return fmt.Errorf("couldn't set certificate: %w", err)
+	if err = k.SetCertificate(mk, rs.slot, cert); err != nil {
+		return "", fmt.Errorf("couldn't set certificate: %w", err)
 	}
 	sshKey, err := ssh.NewPublicKey(pub)
 	if err != nil {
-		return fmt.Errorf("couldn't get SSH public key: %w", err)
+		return "", fmt.Errorf("couldn't get SSH public key: %w", err)
 	}
+	authorizedKey := string(ssh.MarshalAuthorizedKey(sshKey))
 	fmt.Printf("🔑 Generated SSH key, touch policy: %s\n",
-		touchStringMap[touchPolicy])
-	fmt.Printf(string(ssh.MarshalAuthorizedKey(sshKey)))
-	return nil
+		touchStringMap[rs.touchPolicy])
+	fmt.Printf(authorizedKey)
+	return authorizedKey, nil
 }
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/go-piv/piv-go/piv"
+)
+
+func TestVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		name string
+		v    piv.Version
+		min  piv.Version
+		want bool
+	}{
+		{name: "equal", v: piv.Version{Major: 5, Minor: 7}, min: piv.Version{Major: 5, Minor: 7}, want: true},
+		{name: "newer minor", v: piv.Version{Major: 5, Minor: 9}, min: piv.Version{Major: 5, Minor: 7}, want: true},
+		{name: "older minor", v: piv.Version{Major: 5, Minor: 3}, min: piv.Version{Major: 5, Minor: 7}, want: false},
+		{name: "newer major", v: piv.Version{Major: 6, Minor: 0}, min: piv.Version{Major: 5, Minor: 7}, want: true},
+		{name: "older major", v: piv.Version{Major: 4, Minor: 9}, min: piv.Version{Major: 5, Minor: 7}, want: false},
+		{name: "zero floor always satisfied", v: piv.Version{Major: 4, Minor: 0}, min: piv.Version{}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := versionAtLeast(tt.v, tt.min); got != tt.want {
+				t.Errorf("versionAtLeast(%+v, %+v) = %v, want %v", tt.v, tt.min, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlgorithmMatchesKey(t *testing.T) {
+	ec256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("couldn't generate EC256 key: %v", err)
+	}
+	ec384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("couldn't generate EC384 key: %v", err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("couldn't generate RSA key: %v", err)
+	}
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("couldn't generate Ed25519 key: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		alg  piv.Algorithm
+		pub  interface{}
+		want bool
+	}{
+		{name: "ec256 matches ec256 key", alg: piv.AlgorithmEC256, pub: &ec256Key.PublicKey, want: true},
+		{name: "ec256 doesn't match ec384 key", alg: piv.AlgorithmEC256, pub: &ec384Key.PublicKey, want: false},
+		{name: "ec384 matches ec384 key", alg: piv.AlgorithmEC384, pub: &ec384Key.PublicKey, want: true},
+		{name: "rsa2048 matches rsa key", alg: piv.AlgorithmRSA2048, pub: &rsaKey.PublicKey, want: true},
+		{name: "ed25519 matches ed25519 key", alg: piv.AlgorithmEd25519, pub: edPub, want: true},
+		{name: "ed25519 doesn't match ec256 key", alg: piv.AlgorithmEd25519, pub: &ec256Key.PublicKey, want: false},
+		{name: "ec256 doesn't match rsa key", alg: piv.AlgorithmEC256, pub: &rsaKey.PublicKey, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := algorithmMatchesKey(tt.alg, tt.pub); got != tt.want {
+				t.Errorf("algorithmMatchesKey(%v, %T) = %v, want %v", tt.alg, tt.pub, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/go-piv/piv-go/piv"
+	"gopkg.in/yaml.v3"
+)
+
+// SlotConfig describes the desired state of a single PIV slot: which
+// algorithm to generate, its PIN/touch policy, and the subject/validity
+// of the wrapping certificate. It's the unit of a --slots-config file.
+type SlotConfig struct {
+	Slot          string `yaml:"slot"`
+	Algorithm     string `yaml:"algorithm"`
+	PINPolicy     string `yaml:"pin_policy"`
+	TouchPolicy   string `yaml:"touch_policy"`
+	Subject       string `yaml:"subject"`
+	ValidityYears int    `yaml:"validity_years"`
+}
+
+// SlotsConfig is the top-level shape of a --slots-config file: an
+// arbitrary list of slots, including the 20 retired key-management slots
+// (0x82-0x95), each with its own policy.
+type SlotsConfig struct {
+	Slots []SlotConfig `yaml:"slots"`
+}
+
+var pinPolicies = map[string]piv.PINPolicy{
+	"never":  piv.PINPolicyNever,
+	"once":   piv.PINPolicyOnce,
+	"always": piv.PINPolicyAlways,
+}
+
+var touchPolicies = map[string]piv.TouchPolicy{
+	"never":  piv.TouchPolicyNever,
+	"always": piv.TouchPolicyAlways,
+	"cached": piv.TouchPolicyCached,
+}
+
+// loadSlotsConfig reads and parses a --slots-config file. The format
+// (YAML or TOML) isn't distinguished by extension; only YAML (a superset
+// of JSON) is currently implemented.
+func loadSlotsConfig(path string) (*SlotsConfig, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read slots config: %w", err)
+	}
+	var config SlotsConfig
+	if err = yaml.Unmarshal(raw, &config); err != nil {
+		return nil, fmt.Errorf("couldn't parse slots config: %w", err)
+	}
+	if len(config.Slots) == 0 {
+		return nil, fmt.Errorf("slots config declares no slots")
+	}
+	return &config, nil
+}
+
+// resolve validates a SlotsConfig against the security key's firmware
+// capabilities and turns it into the resolvedSlot list setup() iterates
+// over, filling in the same defaults the built-in layout uses.
+func (c *SlotsConfig) resolve(k *piv.YubiKey) ([]resolvedSlot, error) {
+	version := k.Version()
+	result := make([]resolvedSlot, 0, len(c.Slots))
+	for _, sc := range c.Slots {
+		slot, err := parseSlot(sc.Slot)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse slot %q: %w", sc.Slot, err)
+		}
+		algName := sc.Algorithm
+		if algName == "" {
+			algName = "ec256"
+		}
+		alg, ok := keyAlgorithms[algName]
+		if !ok {
+			return nil, fmt.Errorf("slot %q: unknown algorithm %q", sc.Slot, algName)
+		}
+		if alg.pending {
+			return nil, fmt.Errorf("slot %q: algorithm %q is not yet supported by this build's piv-go dependency", sc.Slot, algName)
+		}
+		if !versionAtLeast(version, alg.minVersion) {
+			return nil, fmt.Errorf("slot %q: algorithm %q requires YubiKey firmware %d.%d or later, found %d.%d",
+				sc.Slot, algName, alg.minVersion.Major, alg.minVersion.Minor, version.Major, version.Minor)
+		}
+		pinPolicyName := sc.PINPolicy
+		if pinPolicyName == "" {
+			pinPolicyName = "once"
+		}
+		pinPolicy, ok := pinPolicies[pinPolicyName]
+		if !ok {
+			return nil, fmt.Errorf("slot %q: unknown pin_policy %q", sc.Slot, pinPolicyName)
+		}
+		touchPolicyName := sc.TouchPolicy
+		if touchPolicyName == "" {
+			touchPolicyName = "cached"
+		}
+		touchPolicy, ok := touchPolicies[touchPolicyName]
+		if !ok {
+			return nil, fmt.Errorf("slot %q: unknown touch_policy %q", sc.Slot, touchPolicyName)
+		}
+		subject := sc.Subject
+		if subject == "" {
+			subject = "SSH key"
+		}
+		validityYears := sc.ValidityYears
+		if validityYears == 0 {
+			validityYears = 64
+		}
+		result = append(result, resolvedSlot{
+			slot:          slot,
+			touchPolicy:   touchPolicy,
+			pinPolicy:     pinPolicy,
+			algorithm:     alg,
+			subject:       subject,
+			validityYears: validityYears,
+		})
+	}
+	return result, nil
+}
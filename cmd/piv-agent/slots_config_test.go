@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFile writes contents to path, failing the test on error.
+func writeFile(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("couldn't write %s: %v", path, err)
+	}
+}
+
+func TestLoadSlotsConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "slots.yaml")
+	writeFile(t, path, `
+slots:
+  - slot: "9a"
+    algorithm: ec384
+    touch_policy: always
+    subject: "host key"
+    validity_years: 5
+  - slot: "82"
+    pin_policy: always
+`)
+	config, err := loadSlotsConfig(path)
+	if err != nil {
+		t.Fatalf("loadSlotsConfig returned error: %v", err)
+	}
+	if len(config.Slots) != 2 {
+		t.Fatalf("got %d slots, want 2", len(config.Slots))
+	}
+	first := config.Slots[0]
+	if first.Slot != "9a" || first.Algorithm != "ec384" || first.TouchPolicy != "always" ||
+		first.Subject != "host key" || first.ValidityYears != 5 {
+		t.Errorf("unexpected first slot: %+v", first)
+	}
+	second := config.Slots[1]
+	if second.Slot != "82" || second.PINPolicy != "always" {
+		t.Errorf("unexpected second slot: %+v", second)
+	}
+}
+
+func TestLoadSlotsConfigNoSlots(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "slots.yaml")
+	writeFile(t, path, "slots: []\n")
+	if _, err := loadSlotsConfig(path); err == nil {
+		t.Fatal("expected an error for a slots config with no slots")
+	}
+}
+
+func TestLoadSlotsConfigMissingFile(t *testing.T) {
+	if _, err := loadSlotsConfig("/nonexistent/slots.yaml"); err == nil {
+		t.Fatal("expected an error for a missing slots config file")
+	}
+}